@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ClaimsVerifier validates a bearer token and returns the claims that
+// should be forwarded upstream as x-user-* metadata. It is an interface
+// rather than a concrete JWKS client so tests and alternative deployments
+// can swap in a static-secret or no-op verifier.
+type ClaimsVerifier interface {
+	Verify(ctx context.Context, token string) (map[string]string, error)
+}
+
+// JWKSVerifier validates RS/ES-signed bearer tokens against a remote JWKS
+// endpoint, refetching keys via the jwx auto-refresh cache.
+type JWKSVerifier struct {
+	set jwk.Set
+}
+
+// NewJWKSVerifier fetches (and keeps fresh) the JWKS served at jwksURL.
+func NewJWKSVerifier(ctx context.Context, jwksURL string) (*JWKSVerifier, error) {
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(jwksURL); err != nil {
+		return nil, fmt.Errorf("register jwks cache: %w", err)
+	}
+	if _, err := cache.Refresh(ctx, jwksURL); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	return &JWKSVerifier{set: jwk.NewCachedSet(cache, jwksURL)}, nil
+}
+
+// Verify parses and validates token against the JWKS key set and returns
+// its subject ("sub") plus its string-valued private claims for forwarding
+// as metadata; private claims of any other type are not returned.
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (map[string]string, error) {
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(v.set), jwt.WithValidate(true))
+	if err != nil {
+		return nil, fmt.Errorf("verify bearer token: %w", err)
+	}
+	claims := map[string]string{"sub": parsed.Subject()}
+	for k, v := range parsed.PrivateClaims() {
+		if s, ok := v.(string); ok {
+			claims[k] = s
+		}
+	}
+	return claims, nil
+}
+
+// authMiddleware validates the Authorization: Bearer header against
+// verifier and forwards the resulting claims upstream as x-user-*
+// metadata (picked up by the gateway's incoming header matcher). Requests
+// with no Authorization header are passed through unauthenticated; it is
+// the upstream service's responsibility to reject routes that require it.
+func authMiddleware(verifier ClaimsVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := strings.CutPrefix(auth, "Bearer ")
+			if !ok {
+				http.Error(w, "Authorization header must use Bearer scheme", http.StatusUnauthorized)
+				return
+			}
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid bearer token: %v", err), http.StatusUnauthorized)
+				return
+			}
+			for k, val := range claims {
+				r.Header.Set("x-user-"+k, val)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// noopVerifier accepts any bearer token without forwarding claims; it is
+// the default when AUTH_JWKS_URL is unset so the gateway keeps working in
+// environments without an identity provider configured.
+type noopVerifier struct{}
+
+func (noopVerifier) Verify(ctx context.Context, token string) (map[string]string, error) {
+	return nil, nil
+}
+
+// claimsVerifier builds the ClaimsVerifier used by authMiddleware from
+// AUTH_JWKS_URL, falling back to noopVerifier when it is unset.
+func claimsVerifier(ctx context.Context) ClaimsVerifier {
+	jwksURL := getEnv("AUTH_JWKS_URL", "")
+	if jwksURL == "" {
+		return noopVerifier{}
+	}
+	verifier, err := NewJWKSVerifier(ctx, jwksURL)
+	if err != nil {
+		log.Fatalf("build jwks verifier: %v", err)
+	}
+	return verifier
+}
+
+// userMetadataMatcher forwards headers set by authMiddleware (x-user-*)
+// into gRPC metadata alongside grpc-gateway's default Grpc-Metadata-
+// prefix, so upstream handlers see verified claims without a proto
+// annotation. It falls back to runtime.DefaultHeaderMatcher for everything
+// else, since runtime.WithIncomingHeaderMatcher replaces rather than
+// composes with the default matcher.
+func userMetadataMatcher(header string) (string, bool) {
+	if strings.HasPrefix(strings.ToLower(header), "x-user-") {
+		return strings.ToLower(header), true
+	}
+	return runtime.DefaultHeaderMatcher(header)
+}
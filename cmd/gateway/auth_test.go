@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubVerifier struct {
+	claims map[string]string
+	err    error
+}
+
+func (s stubVerifier) Verify(ctx context.Context, token string) (map[string]string, error) {
+	return s.claims, s.err
+}
+
+func TestAuthMiddlewarePassesThroughWithoutAuthorizationHeader(t *testing.T) {
+	var called bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	rec := httptest.NewRecorder()
+	authMiddleware(noopVerifier{})(next).ServeHTTP(rec, req)
+
+	if !called {
+		t.Fatal("expected requests with no Authorization header to pass through")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected default 200, got %d", rec.Code)
+	}
+}
+
+func TestAuthMiddlewareRejectsNonBearerScheme(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run for a malformed Authorization header")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	rec := httptest.NewRecorder()
+	authMiddleware(noopVerifier{})(next).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for non-Bearer scheme, got %d", rec.Code)
+	}
+}
+
+func TestAuthMiddlewareRejectsVerifierError(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run when the verifier rejects the token")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	req.Header.Set("Authorization", "Bearer bad-token")
+	rec := httptest.NewRecorder()
+	authMiddleware(stubVerifier{err: context.DeadlineExceeded})(next).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 when verification fails, got %d", rec.Code)
+	}
+}
+
+func TestAuthMiddlewareForwardsClaimsAsUserHeaders(t *testing.T) {
+	var gotSub, gotRole string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSub = r.Header.Get("x-user-sub")
+		gotRole = r.Header.Get("x-user-role")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	req.Header.Set("Authorization", "Bearer good-token")
+	rec := httptest.NewRecorder()
+	authMiddleware(stubVerifier{claims: map[string]string{"sub": "user-1", "role": "admin"}})(next).ServeHTTP(rec, req)
+
+	if gotSub != "user-1" || gotRole != "admin" {
+		t.Fatalf("expected claims forwarded as x-user-* headers, got sub=%q role=%q", gotSub, gotRole)
+	}
+}
+
+func TestUserMetadataMatcher(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+		wantOK bool
+	}{
+		{"x-user-sub", "x-user-sub", true},
+		{"X-User-Role", "x-user-role", true},
+		// Not x-user-*, so these fall back to runtime.DefaultHeaderMatcher:
+		// Authorization is one of grpc-gateway's permanent HTTP headers and
+		// still gets forwarded (just not specially, the way x-user-* is),
+		// while an arbitrary custom header like X-Request-Id is dropped.
+		{"authorization", "grpcgateway-Authorization", true},
+		{"x-request-id", "", false},
+	}
+	for _, c := range cases {
+		got, ok := userMetadataMatcher(c.header)
+		if ok != c.wantOK || got != c.want {
+			t.Errorf("userMetadataMatcher(%q) = (%q, %v), want (%q, %v)", c.header, got, ok, c.want, c.wantOK)
+		}
+	}
+}
+
+func TestNoopVerifierAcceptsAnyToken(t *testing.T) {
+	claims, err := noopVerifier{}.Verify(context.Background(), "anything")
+	if err != nil || claims != nil {
+		t.Fatalf("expected noopVerifier to accept any token with no claims, got claims=%v err=%v", claims, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	gw "github.com/berigny/dualsubstrate-commercial/gen/go/proto/dualsubstrate/v1"
+	"github.com/berigny/dualsubstrate-commercial/internal/service"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// newEmbeddedServer constructs the in-process DualSubstrate implementation
+// and a grpc.Server with it registered, so EMBEDDED=1 deployments can serve
+// gRPC and REST from a single http.Server without dialing UPSTREAM_GRPC.
+func newEmbeddedServer() (gw.DualSubstrateServer, *grpc.Server) {
+	impl := service.New()
+	s := grpc.NewServer()
+	gw.RegisterDualSubstrateServer(s, impl)
+	return impl, s
+}
+
+// grpcRouter dispatches HTTP/2 requests whose Content-Type is
+// application/grpc or application/grpc+<codec> to the embedded grpc.Server
+// and everything else (including gRPC-Web's application/grpc-web*) to the
+// grpc-gateway REST mux, so a single port serves both. h2c lets this work
+// over cleartext; TLS listeners negotiate HTTP/2 via ALPN as usual and
+// reach the same handler.
+func grpcRouter(grpcServer *grpc.Server, restHandler http.Handler) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if r.ProtoMajor == 2 && (ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+")) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		restHandler.ServeHTTP(w, r)
+	})
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// embeddedBridgeUnsupportedHandler serves every path that would otherwise
+// go to newBridgeHandler when running with EMBEDDED=1. The gRPC-Web/Connect
+// bridge dials the shared upstream *grpc.ClientConn (see grpcweb.go), which
+// EMBEDDED mode doesn't have — native gRPC and REST clients are served
+// in-process instead via grpcRouter. Until the bridge gains an in-process
+// path, fail loudly rather than 404ing silently.
+func embeddedBridgeUnsupportedHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "gRPC-Web/Connect bridging is not supported in EMBEDDED mode", http.StatusNotImplemented)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestGrpcRouterRoutesGRPCContentTypeAwayFromREST(t *testing.T) {
+	var restHit bool
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restHit = true
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := grpcRouter(grpc.NewServer(), rest)
+
+	req := httptest.NewRequest(http.MethodPost, "/dualsubstrate.v1.DualSubstrate/Method", nil)
+	req.ProtoMajor = 2
+	req.Header.Set("Content-Type", "application/grpc")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if restHit {
+		t.Fatal("expected an application/grpc request to bypass the REST handler")
+	}
+}
+
+func TestGrpcRouterDoesNotMatchGRPCWebContentTypes(t *testing.T) {
+	for _, ct := range []string{"application/grpc-web", "application/grpc-web+proto", "application/grpc-web-text"} {
+		t.Run(ct, func(t *testing.T) {
+			var restHit bool
+			rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				restHit = true
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := grpcRouter(grpc.NewServer(), rest)
+
+			req := httptest.NewRequest(http.MethodPost, "/dualsubstrate.v1.DualSubstrate/Method", nil)
+			req.ProtoMajor = 2
+			req.Header.Set("Content-Type", ct)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if !restHit {
+				t.Fatalf("expected a %s request to fall through to the REST/bridge handler, not the embedded grpc.Server", ct)
+			}
+		})
+	}
+}
+
+func TestGrpcRouterRoutesOtherRequestsToREST(t *testing.T) {
+	var restHit bool
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restHit = true
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := grpcRouter(grpc.NewServer(), rest)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if !restHit {
+		t.Fatal("expected a plain REST request to reach the REST handler")
+	}
+}
+
+func TestEmbeddedBridgeUnsupportedHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/dualsubstrate.v1.DualSubstrate/Method", nil)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec := httptest.NewRecorder()
+
+	embeddedBridgeUnsupportedHandler(rec, req)
+
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected %d, got %d", http.StatusNotImplemented, rec.Code)
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// gRPC-Web and Connect streaming both frame messages the same way gRPC
+// does on the wire: a 1-byte flags prefix, a 4-byte big-endian length, and
+// the payload. flagTrailer marks gRPC-Web's final CRLF-header-lines
+// trailer frame; flagEndStream marks Connect streaming's own final
+// envelope, which carries a JSON body instead (see writeConnectEndStream).
+const (
+	frameHeaderLen  = 5
+	flagCompressed  = 0x1
+	flagTrailer     = 0x80
+	flagEndStream   = 0x02
+	connectProtocol = "1"
+)
+
+// bridgeProtocol is the wire protocol a request to the /<package>.<Service>/<Method>
+// bridge route is using, detected from its Content-Type (and, for Connect
+// unary calls, the Connect-Protocol-Version header).
+type bridgeProtocol int
+
+const (
+	protocolUnknown bridgeProtocol = iota
+	protocolGRPCWeb
+	protocolGRPCWebText
+	protocolConnectUnaryJSON
+	protocolConnectUnaryProto
+	protocolConnectStreamJSON
+	protocolConnectStreamProto
+)
+
+func detectProtocol(r *http.Request) bridgeProtocol {
+	ct := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(ct, "application/grpc-web-text"):
+		return protocolGRPCWebText
+	case strings.HasPrefix(ct, "application/grpc-web"):
+		return protocolGRPCWeb
+	case ct == "application/connect+json":
+		return protocolConnectStreamJSON
+	case ct == "application/connect+proto":
+		return protocolConnectStreamProto
+	case r.Header.Get("Connect-Protocol-Version") != "" && ct == "application/proto":
+		return protocolConnectUnaryProto
+	case r.Header.Get("Connect-Protocol-Version") != "" && ct == "application/json":
+		return protocolConnectUnaryJSON
+	default:
+		return protocolUnknown
+	}
+}
+
+// rawCodec passes message bytes through unchanged. The bridge already has
+// wire-format protobuf bytes decoded out of the incoming framing, so there
+// is nothing left for grpc-go's codec layer to (un)marshal.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: unsupported type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: unsupported type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "raw" }
+
+func readFrame(r io.Reader) (flags byte, payload []byte, err error) {
+	header := make([]byte, frameHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func writeFrame(w io.Writer, flags byte, payload []byte) error {
+	header := make([]byte, frameHeaderLen)
+	header[0] = flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// newBridgeHandler serves browser-native gRPC-Web and Connect clients off
+// the shared upstream conn, translating frames to/from standard gRPC so
+// no proto annotations or separate Envoy sidecar are required.
+func newBridgeHandler(conn *grpc.ClientConn) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fullMethod := r.URL.Path
+
+		switch detectProtocol(r) {
+		case protocolGRPCWeb:
+			serveFramedBridge(w, r, conn, fullMethod, false)
+		case protocolGRPCWebText:
+			serveFramedBridge(w, r, conn, fullMethod, true)
+		case protocolConnectStreamProto:
+			serveConnectStreamBridge(w, r, conn, fullMethod, false)
+		case protocolConnectStreamJSON:
+			serveConnectStreamBridge(w, r, conn, fullMethod, true)
+		case protocolConnectUnaryProto:
+			serveConnectUnary(w, r, conn, fullMethod, false)
+		case protocolConnectUnaryJSON:
+			serveConnectUnary(w, r, conn, fullMethod, true)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// serveFramedBridge bridges gRPC-Web requests, which use gRPC's own
+// length-prefixed message framing. grpc-web-text additionally
+// base64-encodes the whole request and response body.
+func serveFramedBridge(w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn, fullMethod string, base64Framed bool) {
+	body := io.Reader(r.Body)
+	if base64Framed {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	out := io.Writer(w)
+	var b64 *base64Flusher
+	if base64Framed {
+		b64 = newBase64Flusher(w)
+		out = b64
+	}
+	defer func() {
+		if b64 != nil {
+			b64.Close()
+		}
+	}()
+
+	ctx := metadata.NewOutgoingContext(r.Context(), incomingToOutgoing(r.Header))
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, fullMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		writeTrailerFrame(out, nil, err)
+		return
+	}
+
+	for {
+		flags, payload, err := readFrame(body)
+		if err != nil {
+			break
+		}
+		if flags&flagTrailer != 0 {
+			break
+		}
+		if err := stream.SendMsg(&payload); err != nil {
+			break
+		}
+	}
+	_ = stream.CloseSend()
+
+	for {
+		var resp []byte
+		if err := stream.RecvMsg(&resp); err != nil {
+			writeTrailerFrame(out, stream.Trailer(), err)
+			break
+		}
+		_ = writeFrame(out, 0, resp)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// serveConnectStreamBridge bridges Connect client-, server- and
+// bidi-streaming RPCs. Connect streams use the same length-prefixed
+// envelope framing as gRPC-Web for data frames, but terminate the
+// response with Connect's own end-stream envelope (flagEndStream, a JSON
+// body) rather than gRPC-Web's trailer frame; connect+json additionally
+// carries each message as JSON instead of wire-format protobuf, so every
+// frame is translated via connectJSONToProto in each direction.
+func serveConnectStreamBridge(w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn, fullMethod string, jsonFramed bool) {
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Header().Set("Connect-Protocol-Version", connectProtocol)
+
+	ctx := metadata.NewOutgoingContext(r.Context(), incomingToOutgoing(r.Header))
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, fullMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		writeConnectEndStream(w, nil, err)
+		return
+	}
+
+	for {
+		flags, payload, err := readFrame(r.Body)
+		if err != nil {
+			break
+		}
+		if flags&flagEndStream != 0 {
+			break
+		}
+		if jsonFramed {
+			if payload, err = connectJSONToProto(fullMethod, payload, true); err != nil {
+				writeConnectEndStream(w, nil, err)
+				return
+			}
+		}
+		if err := stream.SendMsg(&payload); err != nil {
+			break
+		}
+	}
+	_ = stream.CloseSend()
+
+	for {
+		var resp []byte
+		if err := stream.RecvMsg(&resp); err != nil {
+			writeConnectEndStream(w, stream.Trailer(), err)
+			return
+		}
+		if jsonFramed {
+			if resp, err = connectJSONToProto(fullMethod, resp, false); err != nil {
+				writeConnectEndStream(w, stream.Trailer(), err)
+				return
+			}
+		}
+		_ = writeFrame(w, 0, resp)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// serveConnectUnary handles a Connect unary RPC: a plain (unframed)
+// proto or JSON body in, the response body (or a Connect error envelope)
+// out, with Connect-Protocol-Version on the response.
+func serveConnectUnary(w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn, fullMethod string, jsonBody bool) {
+	w.Header().Set("Connect-Protocol-Version", connectProtocol)
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if jsonBody {
+		if reqBytes, err = connectJSONToProto(fullMethod, reqBytes, true); err != nil {
+			writeConnectError(w, status.Convert(err))
+			return
+		}
+	}
+
+	ctx := metadata.NewOutgoingContext(r.Context(), incomingToOutgoing(r.Header))
+	var respBytes []byte
+	err = conn.Invoke(ctx, fullMethod, &reqBytes, &respBytes, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		writeConnectError(w, status.Convert(err))
+		return
+	}
+
+	if jsonBody {
+		if respBytes, err = connectJSONToProto(fullMethod, respBytes, false); err != nil {
+			writeConnectError(w, status.Convert(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/proto")
+	}
+	_, _ = w.Write(respBytes)
+}
+
+// connectJSONToProto converts a Connect-JSON unary body to/from wire-format
+// protobuf bytes for fullMethod ("/<package>.<Service>/<Method>"), using
+// the method's registered descriptor to build a dynamicpb.Message since
+// the bridge has no generated Go type for an arbitrary RPC.
+func connectJSONToProto(fullMethod string, data []byte, toProto bool) ([]byte, error) {
+	msgDesc, err := connectMessageDescriptor(fullMethod, toProto)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(msgDesc)
+	if toProto {
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			return nil, err
+		}
+		return proto.Marshal(msg)
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(msg)
+}
+
+// connectMessageDescriptor resolves the request (input) or response
+// (output) message descriptor for fullMethod from the global proto
+// registry, which the generated gw package populates on init.
+func connectMessageDescriptor(fullMethod string, input bool) (protoreflect.MessageDescriptor, error) {
+	parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed method path %q", fullMethod)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("resolve service %q: %w", parts[0], err)
+	}
+	svcDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", parts[0])
+	}
+	methods := svcDesc.Methods()
+	methodDesc := methods.ByName(protoreflect.Name(parts[1]))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("unknown method %q on service %q", parts[1], parts[0])
+	}
+	if input {
+		return methodDesc.Input(), nil
+	}
+	return methodDesc.Output(), nil
+}
+
+// nonForwardedHeaders are headers that must not ride along as gRPC
+// metadata on the upstream leg: hop-by-hop headers have no meaning past
+// this hop, Content-* and Host are set by grpc-go's own transport for the
+// gRPC wire format, and Authorization is already verified and translated
+// into x-user-* claims by authMiddleware (mirroring userMetadataMatcher's
+// forwarding of those claims on the REST path).
+var nonForwardedHeaders = map[string]bool{
+	"authorization":       true,
+	"connection":          true,
+	"host":                true,
+	"keep-alive":          true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"upgrade":             true,
+	"accept-encoding":     true,
+}
+
+// incomingToOutgoing forwards the subset of incoming HTTP headers that are
+// safe to carry as gRPC metadata on the upstream leg, dropping hop-by-hop
+// headers, Content-*/Host, and Authorization (see nonForwardedHeaders).
+func incomingToOutgoing(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, vs := range h {
+		lk := strings.ToLower(k)
+		if nonForwardedHeaders[lk] || strings.HasPrefix(lk, "content-") {
+			continue
+		}
+		md[lk] = vs
+	}
+	return md
+}
+
+// writeTrailerFrame writes the gRPC-Web trailer frame
+// carrying the final grpc-status/grpc-message (and any trailing metadata)
+// as CRLF-separated header lines, per the gRPC-Web wire spec.
+func writeTrailerFrame(w io.Writer, trailer metadata.MD, streamErr error) {
+	if streamErr == io.EOF {
+		streamErr = nil
+	}
+	st := status.Convert(streamErr)
+	var b strings.Builder
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", st.Code())
+	fmt.Fprintf(&b, "grpc-message: %s\r\n", st.Message())
+	for k, vs := range trailer {
+		for _, v := range vs {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	_ = writeFrame(w, flagTrailer, []byte(b.String()))
+}
+
+// writeConnectError writes a Connect-protocol error envelope: an HTTP
+// status derived from the gRPC code, with a JSON body shaped
+// {"code": "...", "message": "..."}.
+func writeConnectError(w http.ResponseWriter, st *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(connectHTTPStatus(st.Code()))
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"code":    connectErrorCode(st.Code()),
+		"message": st.Message(),
+	})
+}
+
+type connectStreamError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeConnectEndStream writes the Connect streaming end-of-stream
+// envelope (flagEndStream): a JSON body carrying an "error" object on
+// failure (an io.EOF from a clean RecvMsg loop exit is not an error) and
+// any trailing metadata under "metadata".
+func writeConnectEndStream(w io.Writer, trailer metadata.MD, streamErr error) {
+	if streamErr == io.EOF {
+		streamErr = nil
+	}
+	end := struct {
+		Error    *connectStreamError `json:"error,omitempty"`
+		Metadata map[string][]string `json:"metadata,omitempty"`
+	}{}
+	if streamErr != nil {
+		st := status.Convert(streamErr)
+		end.Error = &connectStreamError{Code: connectErrorCode(st.Code()), Message: st.Message()}
+	}
+	if len(trailer) > 0 {
+		end.Metadata = map[string][]string(trailer)
+	}
+	body, err := json.Marshal(end)
+	if err != nil {
+		body = []byte("{}")
+	}
+	_ = writeFrame(w, flagEndStream, body)
+}
+
+// connectErrorCode maps a gRPC status code to the lower_snake_case code
+// name the Connect protocol uses in its JSON error shape.
+func connectErrorCode(code codes.Code) string {
+	switch code {
+	case codes.Canceled:
+		return "canceled"
+	case codes.Unknown:
+		return "unknown"
+	case codes.InvalidArgument:
+		return "invalid_argument"
+	case codes.DeadlineExceeded:
+		return "deadline_exceeded"
+	case codes.NotFound:
+		return "not_found"
+	case codes.AlreadyExists:
+		return "already_exists"
+	case codes.PermissionDenied:
+		return "permission_denied"
+	case codes.ResourceExhausted:
+		return "resource_exhausted"
+	case codes.FailedPrecondition:
+		return "failed_precondition"
+	case codes.Aborted:
+		return "aborted"
+	case codes.OutOfRange:
+		return "out_of_range"
+	case codes.Unimplemented:
+		return "unimplemented"
+	case codes.Internal:
+		return "internal"
+	case codes.Unavailable:
+		return "unavailable"
+	case codes.DataLoss:
+		return "data_loss"
+	case codes.Unauthenticated:
+		return "unauthenticated"
+	default:
+		return "unknown"
+	}
+}
+
+// connectHTTPStatus maps a gRPC status code to the HTTP status Connect
+// expects unary error responses to carry, per the Connect protocol spec.
+func connectHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// base64Flusher base64-encodes everything written to it (for
+// application/grpc-web-text) and flushes the underlying http.Flusher after
+// every write, since grpc-web-text streams must be decodable incrementally.
+type base64Flusher struct {
+	wc io.WriteCloser
+	f  http.Flusher
+}
+
+func newBase64Flusher(w http.ResponseWriter) *base64Flusher {
+	f, _ := w.(http.Flusher)
+	return &base64Flusher{wc: base64.NewEncoder(base64.StdEncoding, w), f: f}
+}
+
+func (b *base64Flusher) Write(p []byte) (int, error) {
+	n, err := b.wc.Write(p)
+	if b.f != nil {
+		b.f.Flush()
+	}
+	return n, err
+}
+
+func (b *base64Flusher) Close() error {
+	return b.wc.Close()
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDetectProtocol(t *testing.T) {
+	cases := []struct {
+		name    string
+		ct      string
+		connect string
+		want    bridgeProtocol
+	}{
+		{"grpc-web", "application/grpc-web+proto", "", protocolGRPCWeb},
+		{"grpc-web-text", "application/grpc-web-text", "", protocolGRPCWebText},
+		{"connect stream json", "application/connect+json", "", protocolConnectStreamJSON},
+		{"connect stream proto", "application/connect+proto", "", protocolConnectStreamProto},
+		{"connect unary proto", "application/proto", "1", protocolConnectUnaryProto},
+		{"connect unary json", "application/json", "1", protocolConnectUnaryJSON},
+		{"unary proto without connect header", "application/proto", "", protocolUnknown},
+		{"unrecognized", "text/plain", "", protocolUnknown},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+			req.Header.Set("Content-Type", c.ct)
+			if c.connect != "" {
+				req.Header.Set("Connect-Protocol-Version", c.connect)
+			}
+			if got := detectProtocol(req); got != c.want {
+				t.Errorf("detectProtocol(%q, connect=%q) = %v, want %v", c.ct, c.connect, got, c.want)
+			}
+		})
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	payload := []byte("hello frame")
+	if err := writeFrame(&buf, flagCompressed, payload); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+
+	flags, got, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if flags != flagCompressed {
+		t.Errorf("flags = %x, want %x", flags, flagCompressed)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("payload = %q, want %q", got, payload)
+	}
+}
+
+func TestReadFrameErrorsOnShortHeader(t *testing.T) {
+	if _, _, err := readFrame(bytes.NewReader([]byte{0x00, 0x01})); err == nil {
+		t.Fatal("expected an error reading a truncated frame header")
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	c := rawCodec{}
+	payload := []byte("raw bytes")
+
+	marshaled, err := c.Marshal(&payload)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(marshaled, payload) {
+		t.Fatalf("Marshal returned %q, want %q", marshaled, payload)
+	}
+
+	var out []byte
+	if err := c.Unmarshal(marshaled, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("Unmarshal produced %q, want %q", out, payload)
+	}
+
+	if _, err := c.Marshal("not a *[]byte"); err == nil {
+		t.Fatal("expected an error marshaling an unsupported type")
+	}
+	if c.Name() != "raw" {
+		t.Fatalf("Name() = %q, want %q", c.Name(), "raw")
+	}
+}
+
+func TestIncomingToOutgoingDropsUnsafeHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Content-Type", "application/grpc-web+proto")
+	h.Set("Content-Length", "123")
+	h.Set("Connection", "keep-alive")
+	h.Set("Host", "example.com")
+	h.Set("TE", "trailers")
+	h.Set("Accept-Encoding", "gzip")
+	h.Set("X-User-Sub", "user-1")
+	h.Set("X-Request-Id", "req-1")
+
+	md := incomingToOutgoing(h)
+
+	for _, dropped := range []string{"authorization", "content-type", "content-length", "connection", "host", "te", "accept-encoding"} {
+		if vs := md.Get(dropped); len(vs) != 0 {
+			t.Errorf("expected %q to be dropped, got %v", dropped, vs)
+		}
+	}
+	if got := md.Get("x-user-sub"); len(got) != 1 || got[0] != "user-1" {
+		t.Errorf("expected x-user-sub to be forwarded, got %v", got)
+	}
+	if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("expected x-request-id to be forwarded, got %v", got)
+	}
+}
+
+func TestWriteTrailerFrameEncodesGRPCStatus(t *testing.T) {
+	var buf bytes.Buffer
+	writeTrailerFrame(&buf, metadata.Pairs("x-extra", "v"), status.Error(codes.NotFound, "nope"))
+
+	flags, payload, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if flags != flagTrailer {
+		t.Fatalf("flags = %x, want %x", flags, flagTrailer)
+	}
+	text := string(payload)
+	if !strings.Contains(text, "grpc-status: 5\r\n") {
+		t.Errorf("expected grpc-status: 5 (NotFound), got %q", text)
+	}
+	if !strings.Contains(text, "grpc-message: nope\r\n") {
+		t.Errorf("expected grpc-message: nope, got %q", text)
+	}
+	if !strings.Contains(text, "x-extra: v\r\n") {
+		t.Errorf("expected trailing metadata to be included, got %q", text)
+	}
+}
+
+func TestWriteTrailerFrameTreatsEOFAsClean(t *testing.T) {
+	var buf bytes.Buffer
+	writeTrailerFrame(&buf, nil, io.EOF)
+
+	_, payload, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if !strings.Contains(string(payload), "grpc-status: 0\r\n") {
+		t.Errorf("expected grpc-status: 0 for a clean io.EOF, got %q", payload)
+	}
+}
+
+func TestWriteConnectEndStreamSuccess(t *testing.T) {
+	var buf bytes.Buffer
+	writeConnectEndStream(&buf, metadata.Pairs("x-extra", "v"), io.EOF)
+
+	flags, payload, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if flags != flagEndStream {
+		t.Fatalf("flags = %x, want %x", flags, flagEndStream)
+	}
+
+	var end struct {
+		Error    *connectStreamError `json:"error"`
+		Metadata map[string][]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(payload, &end); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if end.Error != nil {
+		t.Errorf("expected no error object for a clean end-of-stream, got %+v", end.Error)
+	}
+	if got := end.Metadata["x-extra"]; len(got) != 1 || got[0] != "v" {
+		t.Errorf("expected trailing metadata to be carried, got %v", end.Metadata)
+	}
+}
+
+func TestWriteConnectEndStreamError(t *testing.T) {
+	var buf bytes.Buffer
+	writeConnectEndStream(&buf, nil, status.Error(codes.InvalidArgument, "bad input"))
+
+	_, payload, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+
+	var end struct {
+		Error *connectStreamError `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &end); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if end.Error == nil || end.Error.Code != "invalid_argument" || end.Error.Message != "bad input" {
+		t.Fatalf("unexpected error envelope: %+v", end.Error)
+	}
+}
+
+func TestConnectErrorCodeMapping(t *testing.T) {
+	cases := map[codes.Code]string{
+		codes.InvalidArgument: "invalid_argument",
+		codes.NotFound:        "not_found",
+		codes.Internal:        "internal",
+		codes.Unauthenticated: "unauthenticated",
+		codes.Code(999):       "unknown",
+	}
+	for code, want := range cases {
+		if got := connectErrorCode(code); got != want {
+			t.Errorf("connectErrorCode(%v) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestConnectHTTPStatusMapping(t *testing.T) {
+	cases := map[codes.Code]int{
+		codes.InvalidArgument: http.StatusBadRequest,
+		codes.NotFound:        http.StatusNotFound,
+		codes.Unauthenticated: http.StatusUnauthorized,
+		codes.Unavailable:     http.StatusServiceUnavailable,
+		codes.Code(999):       http.StatusInternalServerError,
+	}
+	for code, want := range cases {
+		if got := connectHTTPStatus(code); got != want {
+			t.Errorf("connectHTTPStatus(%v) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestWriteConnectErrorBody(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeConnectError(rec, status.New(codes.NotFound, "missing"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if body["code"] != "not_found" || body["message"] != "missing" {
+		t.Fatalf("unexpected error body %v", body)
+	}
+}
+
+func TestBase64Flusher(t *testing.T) {
+	rec := httptest.NewRecorder()
+	f := newBase64Flusher(rec)
+
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(rec.Body.String())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(decoded) != "hello" {
+		t.Fatalf("decoded %q, want %q", decoded, "hello")
+	}
+}
+
+func TestConnectJSONToProtoRoundTrip(t *testing.T) {
+	fullMethod := registerTestGRPCWebService(t)
+
+	jsonBody := []byte(`{"id":"widget-1"}`)
+	protoBytes, err := connectJSONToProto(fullMethod, jsonBody, true)
+	if err != nil {
+		t.Fatalf("connectJSONToProto (to proto): %v", err)
+	}
+	if len(protoBytes) == 0 {
+		t.Fatal("expected non-empty proto bytes")
+	}
+
+	roundTripped, err := connectJSONToProto(fullMethod, protoBytes, false)
+	if err != nil {
+		t.Fatalf("connectJSONToProto (to json): %v", err)
+	}
+	if !bytes.Contains(roundTripped, []byte("widget-1")) {
+		t.Fatalf("expected round-tripped JSON to contain %q, got %q", "widget-1", roundTripped)
+	}
+}
+
+func TestConnectMessageDescriptorUnknownMethod(t *testing.T) {
+	fullMethod := registerTestGRPCWebService(t)
+	badMethod := fullMethod[:strings.LastIndex(fullMethod, "/")] + "/NoSuchMethod"
+
+	if _, err := connectMessageDescriptor(badMethod, true); err == nil {
+		t.Fatal("expected an error for an unknown method")
+	}
+	if _, err := connectMessageDescriptor("malformed", true); err == nil {
+		t.Fatal("expected an error for a malformed method path")
+	}
+}
+
+func TestConnectMessageDescriptorRejectsNonServiceName(t *testing.T) {
+	registerTestGRPCWebService(t)
+
+	// "grpcwebtest.Widget" is a registered message, not a service: resolving
+	// it must return an error rather than panicking on the service type
+	// assertion.
+	if _, err := connectMessageDescriptor("/grpcwebtest.Widget/Method", true); err == nil {
+		t.Fatal("expected an error when the path names a message, not a service")
+	}
+}
+
+var registeredTestService bool
+
+// registerTestGRPCWebService registers a tiny service/method descriptor pair
+// into the global proto registry (the same registry the generated gw
+// package populates on init) so connectJSONToProto/connectMessageDescriptor
+// can be exercised without a real generated Go package.
+func registerTestGRPCWebService(t *testing.T) string {
+	t.Helper()
+	const fullMethod = "/grpcwebtest.Widgets/Get"
+	if registeredTestService {
+		return fullMethod
+	}
+	registeredTestService = true
+
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("grpcweb_test.proto"),
+		Package: proto.String("grpcwebtest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Widget"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				JsonName: proto.String("id"),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Widgets"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Get"),
+				InputType:  proto.String(".grpcwebtest.Widget"),
+				OutputType: proto.String(".grpcwebtest.Widget"),
+			}},
+		}},
+	}
+	file, err := protodesc.NewFile(fd, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("protodesc.NewFile: %v", err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(file); err != nil {
+		t.Fatalf("RegisterFile: %v", err)
+	}
+	return fullMethod
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+const defaultDrainTimeout = 10 * time.Second
+
+// buildUpstreamConn dials a single shared *grpc.ClientConn for the
+// upstream, used by every RegisterXxxHandler call instead of each opening
+// its own connection. The dns:/// scheme plus round_robin balancing lets
+// the resolver track multiple upstream endpoints, and keepalive params
+// keep idle connections from being reaped by intermediate proxies.
+func buildUpstreamConn(upstream string) (*grpc.ClientConn, error) {
+	creds, err := upstreamCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("build upstream credentials: %w", err)
+	}
+	return grpc.NewClient(
+		"dns:///"+upstream,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+}
+
+// healthzHandler reports process liveness: 200 as long as the gateway is
+// running, regardless of upstream state. Kubernetes uses this to decide
+// whether to restart the container.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyzHandler reports traffic readiness by probing the upstream's gRPC
+// Health service. It short-circuits to NOT_SERVING when the shared conn is
+// in TRANSIENT_FAILURE so Kubernetes stops routing traffic without
+// waiting for a slow RPC timeout.
+func readyzHandler(conn *grpc.ClientConn) http.HandlerFunc {
+	client := grpc_health_v1.NewHealthClient(conn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if conn.GetState() == connectivity.TransientFailure {
+			http.Error(w, "NOT_SERVING", http.StatusServiceUnavailable)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil || resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+			http.Error(w, "NOT_SERVING", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("SERVING"))
+	}
+}
+
+// embeddedReadyzHandler always reports ready: in EMBEDDED mode the
+// "upstream" is the process itself, so there is no separate connection to
+// probe.
+func embeddedReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("SERVING"))
+}
+
+// runWithGracefulShutdown starts srv in the background and blocks until
+// SIGTERM/SIGINT, then drains in-flight requests via srv.Shutdown with a
+// bounded timeout so Kubernetes can terminate the pod cleanly.
+func runWithGracefulShutdown(srv *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serveListener(srv)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	drainTimeout := defaultDrainTimeout
+	if v := getEnv("GATEWAY_DRAIN_TIMEOUT", ""); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			drainTimeout = d
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestBuildUpstreamConnDoesNotDialEagerly(t *testing.T) {
+	t.Setenv("UPSTREAM_TLS", "")
+
+	conn, err := buildUpstreamConn("localhost:1")
+	if err != nil {
+		t.Fatalf("buildUpstreamConn: %v", err)
+	}
+	defer conn.Close()
+
+	if conn == nil {
+		t.Fatal("expected a non-nil *grpc.ClientConn")
+	}
+	if state := conn.GetState(); state != connectivity.Idle {
+		t.Fatalf("expected the conn to stay IDLE until first use, got %v", state)
+	}
+}
+
+func TestHealthzHandlerAlwaysOK(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+
+	healthzHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "ok" {
+		t.Fatalf("expected body %q, got %q", "ok", rec.Body.String())
+	}
+}
+
+func TestEmbeddedReadyzHandlerAlwaysServing(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+
+	embeddedReadyzHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "SERVING" {
+		t.Fatalf("expected body %q, got %q", "SERVING", rec.Body.String())
+	}
+}
+
+func TestReadyzHandlerNotServingWhenUpstreamUnreachable(t *testing.T) {
+	t.Setenv("UPSTREAM_TLS", "")
+
+	// A connection to a closed local port never reaches SERVING, and the
+	// health RPC itself will fail or time out, so readyzHandler must report
+	// NOT_SERVING rather than blocking or panicking.
+	conn, err := buildUpstreamConn("127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("buildUpstreamConn: %v", err)
+	}
+	defer conn.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+	readyzHandler(conn)(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+}
@@ -10,8 +10,8 @@ import (
 
 	gw "github.com/berigny/dualsubstrate-commercial/gen/go/proto/dualsubstrate/v1"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
@@ -27,14 +27,34 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	mux := runtime.NewServeMux(
+		runtime.WithMetadata(requestIDAnnotator),
+		runtime.WithIncomingHeaderMatcher(userMetadataMatcher),
+		runtime.WithMarshalerOption("application/x-ndjson", &ndjsonMarshaler{}),
+		runtime.WithMarshalerOption("text/event-stream", &sseMarshaler{}),
+	)
 
-	if err := gw.RegisterDualSubstrateHandlerFromEndpoint(ctx, mux, upstream, opts); err != nil {
-		log.Fatalf("register dual substrate handler: %v", err)
-	}
-	if err := gw.RegisterHealthHandlerFromEndpoint(ctx, mux, upstream, opts); err != nil {
-		log.Printf("warn: register health handler: %v", err)
+	var embeddedGRPC *grpc.Server
+	var upstreamConn *grpc.ClientConn
+	if getEnv("EMBEDDED", "") != "" {
+		impl, grpcServer := newEmbeddedServer()
+		if err := gw.RegisterDualSubstrateHandlerServer(ctx, mux, impl); err != nil {
+			log.Fatalf("register dual substrate handler: %v", err)
+		}
+		embeddedGRPC = grpcServer
+	} else {
+		conn, err := buildUpstreamConn(upstream)
+		if err != nil {
+			log.Fatalf("dial upstream: %v", err)
+		}
+		upstreamConn = conn
+
+		if err := gw.RegisterDualSubstrateHandler(ctx, mux, conn); err != nil {
+			log.Fatalf("register dual substrate handler: %v", err)
+		}
+		if err := gw.RegisterHealthHandler(ctx, mux, conn); err != nil {
+			log.Printf("warn: register health handler: %v", err)
+		}
 	}
 
 	redocHTML := redocPage()
@@ -54,15 +74,41 @@ func main() {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		_, _ = w.Write([]byte(redocHTML))
 	}))
+	rootMux.Handle("/metrics", promhttp.Handler())
+	rootMux.HandleFunc("/healthz", healthzHandler)
+	if upstreamConn != nil {
+		rootMux.HandleFunc("/readyz", readyzHandler(upstreamConn))
+		rootMux.Handle("/", newBridgeHandler(upstreamConn))
+	} else {
+		rootMux.HandleFunc("/readyz", embeddedReadyzHandler)
+		log.Printf("warn: EMBEDDED=1 has no gRPC-Web/Connect bridge yet; those clients get %d on every route", http.StatusNotImplemented)
+		rootMux.Handle("/", http.HandlerFunc(embeddedBridgeUnsupportedHandler))
+	}
+
+	var rootHandler http.Handler = rootMux
+	if embeddedGRPC != nil {
+		rootHandler = grpcRouter(embeddedGRPC, rootMux)
+	}
+
+	gateway := NewGateway(rootHandler)
+	gateway.Use(requestIDMiddleware, loggingMiddleware, authMiddleware(claimsVerifier(ctx)), metricsMiddleware, sseHeartbeatMiddleware)
 
 	srv := &http.Server{
 		Addr:              listenAddr,
-		Handler:           rootMux,
+		Handler:           gateway.Handler(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	log.Printf("gateway listening on %s -> %s", listenAddr, upstream)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if embeddedGRPC != nil {
+		log.Printf("gateway listening on %s (embedded upstream)", listenAddr)
+	} else {
+		log.Printf("gateway listening on %s -> %s", listenAddr, upstream)
+	}
+	err := runWithGracefulShutdown(srv)
+	if upstreamConn != nil {
+		_ = upstreamConn.Close()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("gateway server error: %v", err)
 	}
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ndjsonMarshaler emits one JSON object per line instead of grpc-gateway's
+// default `{"result": ...}` chunked framing, so a plain CLI consumer can
+// just read line-delimited JSON off a server-streaming RPC.
+type ndjsonMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *ndjsonMarshaler) ContentType(v interface{}) string {
+	return "application/x-ndjson"
+}
+
+func (m *ndjsonMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sseFieldMask names the field (if present as a string-valued top-level
+// proto field) used to derive the SSE `id:` line, configurable via
+// SSE_ID_FIELD so different streaming RPCs can opt a message field in
+// without gateway code changes.
+var sseFieldMask = getEnv("SSE_ID_FIELD", "")
+
+// sseMarshaler formats each streamed message as a Server-Sent Events
+// `data:` frame so a browser EventSource can consume server-streaming
+// RPCs directly.
+type sseMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *sseMarshaler) ContentType(v interface{}) string {
+	return "text/event-stream"
+}
+
+func (m *sseMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if id := sseFieldValue(v, sseFieldMask); id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	buf.WriteString("event: message\n")
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// sseFieldValue reads a string-valued field named field off v via
+// protoreflect, returning "" when field is unset, unconfigured, v isn't a
+// proto.Message, or the field isn't a string.
+func sseFieldValue(v interface{}, field string) string {
+	if field == "" {
+		return ""
+	}
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return ""
+	}
+	fd := msg.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil || fd.Kind() != protoreflect.StringKind {
+		return ""
+	}
+	return msg.ProtoReflect().Get(fd).String()
+}
+
+const defaultSSEHeartbeat = 15 * time.Second
+
+// heartbeatWriter wraps an http.ResponseWriter so sseHeartbeatMiddleware
+// can interleave periodic SSE comment frames (`: heartbeat`) with the
+// handler's own writes, keeping idle connections (and any intermediate
+// proxy timeouts) alive during long gaps between streamed messages.
+type heartbeatWriter struct {
+	http.ResponseWriter
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHeartbeatWriter(w http.ResponseWriter, interval time.Duration) *heartbeatWriter {
+	hw := &heartbeatWriter{ResponseWriter: w, stop: make(chan struct{}), done: make(chan struct{})}
+	go hw.loop(interval)
+	return hw
+}
+
+func (h *heartbeatWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ResponseWriter.Write(p)
+}
+
+func (h *heartbeatWriter) Flush() {
+	if f, ok := h.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close signals loop to stop and blocks until it has actually exited, so the
+// caller (sseHeartbeatMiddleware, via defer) never returns from ServeHTTP
+// while the heartbeat goroutine might still be writing to the
+// ResponseWriter — on a reused keep-alive connection that write would race
+// whatever the next request writes.
+func (h *heartbeatWriter) close() {
+	close(h.stop)
+	<-h.done
+}
+
+func (h *heartbeatWriter) loop(interval time.Duration) {
+	defer close(h.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			_, _ = io.WriteString(h.ResponseWriter, ": heartbeat\n\n")
+			h.Flush()
+			h.mu.Unlock()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// sseHeartbeatMiddleware keeps text/event-stream responses alive by
+// writing a heartbeat comment frame every SSE_HEARTBEAT_INTERVAL (default
+// 15s) while the handler is streaming.
+func sseHeartbeatMiddleware(next http.Handler) http.Handler {
+	interval := defaultSSEHeartbeat
+	if v := getEnv("SSE_HEARTBEAT_INTERVAL", ""); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			interval = d
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hw := newHeartbeatWriter(w, interval)
+		defer hw.close()
+		next.ServeHTTP(hw, r)
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newTestMessage builds a dynamicpb.Message with a string field "id" and an
+// int32 field "count", so sseFieldValue can be exercised against a real
+// proto.Message without needing the generated gw package.
+func newTestMessage(t *testing.T, id string, count int32) proto.Message {
+	t.Helper()
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("marshalers_test.proto"),
+		Package: proto.String("marshalerstest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("id"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("id"),
+				},
+				{
+					Name:     proto.String("count"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("count"),
+				},
+			},
+		}},
+	}
+	file, err := protodesc.NewFile(fd, nil)
+	if err != nil {
+		t.Fatalf("protodesc.NewFile: %v", err)
+	}
+	msgDesc := file.Messages().ByName(protoreflect.Name("Event"))
+	msg := dynamicpb.NewMessage(msgDesc)
+	msg.Set(msgDesc.Fields().ByName("id"), protoreflect.ValueOfString(id))
+	msg.Set(msgDesc.Fields().ByName("count"), protoreflect.ValueOfInt32(count))
+	return msg
+}
+
+func TestNdjsonMarshalerAppendsNewline(t *testing.T) {
+	m := &ndjsonMarshaler{}
+	data, err := m.Marshal(newTestMessage(t, "evt-1", 3))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		t.Fatalf("expected ndjsonMarshaler output to end in a newline, got %q", data)
+	}
+	if m.ContentType(nil) != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", m.ContentType(nil))
+	}
+}
+
+func TestSSEMarshalerFramesDataAndEventLines(t *testing.T) {
+	m := &sseMarshaler{}
+	data, err := m.Marshal(newTestMessage(t, "evt-1", 3))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Contains(data, []byte("event: message\n")) {
+		t.Fatalf("expected an `event: message` line, got %q", data)
+	}
+	if !bytes.Contains(data, []byte("data: ")) {
+		t.Fatalf("expected `data: ` frame lines, got %q", data)
+	}
+	if !bytes.HasSuffix(data, []byte("\n\n")) {
+		t.Fatalf("expected frame to end with a blank line, got %q", data)
+	}
+	if m.ContentType(nil) != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", m.ContentType(nil))
+	}
+}
+
+func TestSSEMarshalerIncludesIDLineWhenConfigured(t *testing.T) {
+	t.Setenv("SSE_ID_FIELD", "")
+	oldMask := sseFieldMask
+	sseFieldMask = "id"
+	defer func() { sseFieldMask = oldMask }()
+
+	m := &sseMarshaler{}
+	data, err := m.Marshal(newTestMessage(t, "evt-42", 1))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Contains(data, []byte("id: evt-42\n")) {
+		t.Fatalf("expected an `id: evt-42` line, got %q", data)
+	}
+}
+
+func TestSSEFieldValue(t *testing.T) {
+	msg := newTestMessage(t, "evt-7", 5)
+
+	if got := sseFieldValue(msg, "id"); got != "evt-7" {
+		t.Errorf("sseFieldValue(id) = %q, want %q", got, "evt-7")
+	}
+	if got := sseFieldValue(msg, "count"); got != "" {
+		t.Errorf("sseFieldValue(count) = %q, want empty (non-string field)", got)
+	}
+	if got := sseFieldValue(msg, ""); got != "" {
+		t.Errorf("sseFieldValue(\"\") = %q, want empty (unconfigured)", got)
+	}
+	if got := sseFieldValue("not a proto message", "id"); got != "" {
+		t.Errorf("sseFieldValue(non-proto) = %q, want empty", got)
+	}
+}
+
+func TestSSEHeartbeatMiddlewareSendsHeartbeatFrames(t *testing.T) {
+	t.Setenv("SSE_HEARTBEAT_INTERVAL", "10ms")
+
+	blockUntilDone := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blockUntilDone
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		sseHeartbeatMiddleware(next).ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(blockUntilDone)
+	<-done
+
+	if !bytes.Contains(rec.Body.Bytes(), []byte(": heartbeat\n\n")) {
+		t.Fatalf("expected at least one heartbeat comment frame, got %q", rec.Body.String())
+	}
+}
+
+func TestSSEHeartbeatMiddlewareSkipsNonSSERequests(t *testing.T) {
+	var called bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := w.(*heartbeatWriter); ok {
+			t.Fatal("expected a plain ResponseWriter for a non-SSE request")
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	rec := httptest.NewRecorder()
+	sseHeartbeatMiddleware(next).ServeHTTP(rec, req)
+
+	if !called {
+		t.Fatal("expected the wrapped handler to run")
+	}
+}
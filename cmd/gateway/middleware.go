@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDHeader is the HTTP header carrying the request ID, both on the
+// way in (if a caller/ingress already set one) and on the way out.
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// Gateway wraps the root http.Handler with a composable middleware chain.
+// Downstream users can layer in their own middleware via Use before the
+// chain is built with Handler.
+type Gateway struct {
+	base http.Handler
+	mws  []func(http.Handler) http.Handler
+}
+
+// NewGateway wraps base, the handler that ultimately serves REST/gRPC
+// traffic, so middleware can be layered around it.
+func NewGateway(base http.Handler) *Gateway {
+	return &Gateway{base: base}
+}
+
+// Use appends middleware to the chain, in the order they should run on a
+// request (the first mw added sees the request first).
+func (g *Gateway) Use(mw ...func(http.Handler) http.Handler) {
+	g.mws = append(g.mws, mw...)
+}
+
+// Handler builds the final http.Handler by wrapping base with every
+// middleware registered via Use.
+func (g *Gateway) Handler() http.Handler {
+	h := g.base
+	for i := len(g.mws) - 1; i >= 0; i-- {
+		h = g.mws[i](h)
+	}
+	return h
+}
+
+// requestIDMiddleware assigns a request ID (reusing one supplied by an
+// upstream proxy, if present), stashes it in the request context for
+// logging and the gRPC metadata annotator, and echoes it back on the
+// response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDAnnotator is passed to the grpc-gateway mux via
+// runtime.WithMetadata so the request ID set by requestIDMiddleware rides
+// along as gRPC metadata on the upstream call. It also doubles as the one
+// place with access to the RPC method grpc-gateway resolved for ctx, which
+// it reports back to metricsMiddleware via routeCapture (see there for
+// why a side channel is needed instead of just reading r.Context()).
+func requestIDAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if rc, ok := ctx.Value(routeCaptureKey{}).(*routeCapture); ok {
+		if method, ok := runtime.RPCMethod(ctx); ok {
+			rc.route = method
+		}
+	}
+
+	id := requestIDFromContext(ctx)
+	if id == "" {
+		id = r.Header.Get(requestIDHeader)
+	}
+	if id == "" {
+		return nil
+	}
+	return metadata.Pairs("x-request-id", id)
+}
+
+type routeCaptureKey struct{}
+
+// routeCapture is a mutable side channel metricsMiddleware threads through
+// the request context: grpc-gateway's ServeMux only learns (and tags its
+// context with) the matched RPC method deep inside its own ServeHTTP, on a
+// context derived from ours rather than one we get back, so there is no
+// way to read it from the context metricsMiddleware still holds after
+// next.ServeHTTP returns. A shared pointer sidesteps that — requestIDAnnotator
+// runs on a context descended from the one metricsMiddleware injected, so it
+// can reach the same routeCapture and write the route into it.
+type routeCapture struct {
+	route string
+}
+
+// statusRecorder captures the status code written by downstream handlers
+// so logging and metrics middleware can report on it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets statusRecorder pass through to the underlying ResponseWriter's
+// http.Flusher, if it has one. Without this, embedding http.ResponseWriter
+// as an interface field hides Flusher from downstream handlers (grpc-gateway's
+// streaming forwarder, the gRPC-Web/Connect bridge and the heartbeat writer
+// all type-assert for it), so
+// streamed responses would buffer instead of flushing per-chunk.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying ResponseWriter's http.Hijacker,
+// if it has one. grpcRouter's h2c.NewHandler needs this for HTTP/2
+// prior-knowledge connections (how real gRPC clients dial h2c): without it,
+// initH2CWithPriorKnowledge's `w.(http.Hijacker)` assertion fails and the
+// request is silently served as if it were plain HTTP/1.1.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support Hijack")
+	}
+	return h.Hijack()
+}
+
+// loggingMiddleware emits one structured JSON access log line per request:
+// method, path, status, latency, peer and request-ID.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		entry := map[string]any{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     rec.status,
+			"latency_ms": time.Since(start).Milliseconds(),
+			"peer":       r.RemoteAddr,
+			"request_id": requestIDFromContext(r.Context()),
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("access log marshal error: %v", err)
+			return
+		}
+		log.Println(string(line))
+	})
+}
+
+var (
+	requestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gateway_request_duration_seconds",
+		Help: "Latency of gateway requests by route and method.",
+	}, []string{"method", "route"})
+
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_requests_total",
+		Help: "Count of gateway requests by route, method and status code.",
+	}, []string{"method", "route", "status"})
+)
+
+// metricsMiddleware records a latency histogram and status-code counter
+// per route, exposed on /metrics for Prometheus scraping. The route label
+// is the RPC method grpc-gateway resolved for this request (reported back
+// via routeCapture/requestIDAnnotator), so every RPC gets its own bucket
+// instead of every request collapsing onto the outer
+// rootMux.Handle("/v1/", mux) pattern. Requests that never reach the
+// grpc-gateway mux (/healthz, /metrics, the gRPC-Web/Connect bridge, ...)
+// fall back to the raw ServeMux pattern or URL path.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rc := &routeCapture{}
+		ctx := context.WithValue(r.Context(), routeCaptureKey{}, rc)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// ServeMux records the matched pattern on the request it is handed,
+		// which is this copy rather than r.
+		req := r.WithContext(ctx)
+		next.ServeHTTP(rec, req)
+
+		route := rc.route
+		if route == "" {
+			route = req.Pattern
+		}
+		if route == "" {
+			route = r.URL.Path
+		}
+		requestLatency.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+	})
+}
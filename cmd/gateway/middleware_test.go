@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDMiddlewareGeneratesAndEchoesID(t *testing.T) {
+	var gotID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = requestIDFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	rec := httptest.NewRecorder()
+	requestIDMiddleware(next).ServeHTTP(rec, req)
+
+	if gotID == "" {
+		t.Fatal("expected requestIDMiddleware to stash a generated ID in the context")
+	}
+	if rec.Header().Get(requestIDHeader) != gotID {
+		t.Fatalf("expected response header %s to echo the context ID %q, got %q", requestIDHeader, gotID, rec.Header().Get(requestIDHeader))
+	}
+}
+
+func TestRequestIDMiddlewarePreservesIncomingID(t *testing.T) {
+	var gotID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = requestIDFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	req.Header.Set(requestIDHeader, "caller-supplied-id")
+	rec := httptest.NewRecorder()
+	requestIDMiddleware(next).ServeHTTP(rec, req)
+
+	if gotID != "caller-supplied-id" {
+		t.Fatalf("expected incoming request ID to be preserved, got %q", gotID)
+	}
+}
+
+func TestGatewayHandlerRunsMiddlewareInUseOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	base := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "base")
+	})
+	gw := NewGateway(base)
+	gw.Use(mw("first"), mw("second"))
+
+	gw.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{"first", "second", "base"}
+	if len(order) != len(want) {
+		t.Fatalf("got call order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got call order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestMetricsMiddlewareHandlesUncapturedRoute(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Simulate grpc-gateway's annotator hook running on a context
+		// descended from the one metricsMiddleware injected.
+		requestIDAnnotator(r.Context(), r)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/widgets", nil)
+	rec := httptest.NewRecorder()
+
+	// requestIDAnnotator only writes into routeCapture when runtime.RPCMethod
+	// resolves on ctx, which requires a real grpc-gateway-annotated context;
+	// outside that, metricsMiddleware falls back to the ServeMux pattern or
+	// r.URL.Path. This checks that the fallback path runs without panicking.
+	metricsMiddleware(next).ServeHTTP(rec, req)
+}
+
+func TestRequestIDAnnotatorForwardsHeaderAsMetadata(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+	req.Header.Set(requestIDHeader, "abc-123")
+
+	md := requestIDAnnotator(context.Background(), req)
+
+	if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "abc-123" {
+		t.Fatalf("expected x-request-id metadata %q, got %v", "abc-123", got)
+	}
+}
+
+func TestRequestIDAnnotatorNilWithoutHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/widgets", nil)
+
+	if md := requestIDAnnotator(context.Background(), req); md != nil {
+		t.Fatalf("expected nil metadata when no request ID header is set, got %v", md)
+	}
+}
+
+// hijackableRecorder is an httptest.ResponseRecorder that also implements
+// http.Hijacker, so statusRecorder's Hijack passthrough has something real
+// to assert against (httptest.NewRecorder's ResponseRecorder does not
+// implement http.Hijacker on its own).
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	client, _ := net.Pipe()
+	return client, bufio.NewReadWriter(bufio.NewReader(client), bufio.NewWriter(client)), nil
+}
+
+func TestStatusRecorderHijackPassesThrough(t *testing.T) {
+	underlying := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec := &statusRecorder{ResponseWriter: underlying, status: http.StatusOK}
+
+	conn, _, err := rec.Hijack()
+	if err != nil {
+		t.Fatalf("Hijack: %v", err)
+	}
+	defer conn.Close()
+
+	if !underlying.hijacked {
+		t.Fatal("expected statusRecorder.Hijack to call through to the underlying Hijacker")
+	}
+}
+
+func TestStatusRecorderHijackErrorsWithoutUnderlyingHijacker(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+
+	if _, _, err := rec.Hijack(); err == nil {
+		t.Fatal("expected an error when the underlying ResponseWriter does not support Hijack")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// upstreamCredentials builds the TransportCredentials used to dial the
+// upstream gRPC service. It is a package-level factory variable rather than
+// an inline call so tests (and alternative deployments, e.g. xDS or
+// SPIFFE-based mTLS) can replace it with one returning their own
+// credentials.TransportCredentials without touching main.
+var upstreamCredentials = envUpstreamCredentials
+
+// envUpstreamCredentials is the default upstreamCredentials: insecure
+// credentials unless UPSTREAM_TLS is set, otherwise TLS configured from
+// UPSTREAM_CA_FILE, UPSTREAM_CLIENT_CERT/UPSTREAM_CLIENT_KEY and
+// UPSTREAM_SERVER_NAME.
+func envUpstreamCredentials() (credentials.TransportCredentials, error) {
+	if getEnv("UPSTREAM_TLS", "") == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsCfg := &tls.Config{}
+
+	if caFile := getEnv("UPSTREAM_CA_FILE", ""); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read upstream CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("parse upstream CA file %q: no certificates found", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	certFile := getEnv("UPSTREAM_CLIENT_CERT", "")
+	keyFile := getEnv("UPSTREAM_CLIENT_KEY", "")
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("UPSTREAM_CLIENT_CERT and UPSTREAM_CLIENT_KEY must both be set for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load upstream client keypair: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if serverName := getEnv("UPSTREAM_SERVER_NAME", ""); serverName != "" {
+		tlsCfg.ServerName = serverName
+	}
+
+	return credentials.NewTLS(tlsCfg), nil
+}
+
+// serveListener wraps srv.ListenAndServe / srv.ListenAndServeTLS, picking
+// plain HTTP, a static cert/key pair, or ACME autocert based on environment
+// configuration.
+func serveListener(srv *http.Server) error {
+	certFile := getEnv("GATEWAY_TLS_CERT", "")
+	keyFile := getEnv("GATEWAY_TLS_KEY", "")
+	domains := getEnv("GATEWAY_AUTOCERT_DOMAINS", "")
+
+	switch {
+	case domains != "":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(splitCSV(domains)...),
+			Cache:      autocert.DirCache(getEnv("GATEWAY_AUTOCERT_CACHE_DIR", "autocert-cache")),
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		return srv.ListenAndServeTLS("", "")
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("GATEWAY_TLS_CERT and GATEWAY_TLS_KEY must both be set")
+		}
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	default:
+		return srv.ListenAndServe()
+	}
+}
+
+func splitCSV(s string) []string {
+	var out []string
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ',' {
+			if v := s[start:i]; v != "" {
+				out = append(out, v)
+			}
+			start = i + 1
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestUpstreamCredentialsInsecureByDefault(t *testing.T) {
+	for _, k := range []string{"UPSTREAM_TLS", "UPSTREAM_CA_FILE", "UPSTREAM_CLIENT_CERT", "UPSTREAM_CLIENT_KEY", "UPSTREAM_SERVER_NAME"} {
+		t.Setenv(k, "")
+	}
+
+	creds, err := upstreamCredentials()
+	if err != nil {
+		t.Fatalf("upstreamCredentials: %v", err)
+	}
+	if creds.Info().SecurityProtocol != insecure.NewCredentials().Info().SecurityProtocol {
+		t.Fatalf("expected insecure credentials when UPSTREAM_TLS is unset, got %v", creds.Info())
+	}
+}
+
+func TestUpstreamCredentialsMissingCAFile(t *testing.T) {
+	t.Setenv("UPSTREAM_TLS", "1")
+	t.Setenv("UPSTREAM_CA_FILE", filepath.Join(t.TempDir(), "does-not-exist.pem"))
+
+	if _, err := upstreamCredentials(); err == nil {
+		t.Fatal("expected an error for a missing UPSTREAM_CA_FILE")
+	}
+}
+
+func TestUpstreamCredentialsRequiresBothClientCertAndKey(t *testing.T) {
+	t.Setenv("UPSTREAM_TLS", "1")
+	t.Setenv("UPSTREAM_CA_FILE", "")
+	t.Setenv("UPSTREAM_CLIENT_CERT", filepath.Join(t.TempDir(), "client.crt"))
+	t.Setenv("UPSTREAM_CLIENT_KEY", "")
+
+	if _, err := upstreamCredentials(); err == nil {
+		t.Fatal("expected an error when only UPSTREAM_CLIENT_CERT is set")
+	}
+}
+
+func TestUpstreamCredentialsTLSWithCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(testCAPEM), 0o600); err != nil {
+		t.Fatalf("write test CA file: %v", err)
+	}
+
+	t.Setenv("UPSTREAM_TLS", "1")
+	t.Setenv("UPSTREAM_CA_FILE", caFile)
+	t.Setenv("UPSTREAM_CLIENT_CERT", "")
+	t.Setenv("UPSTREAM_CLIENT_KEY", "")
+	t.Setenv("UPSTREAM_SERVER_NAME", "upstream.internal")
+
+	creds, err := upstreamCredentials()
+	if err != nil {
+		t.Fatalf("upstreamCredentials: %v", err)
+	}
+	if creds.Info().ServerName != "upstream.internal" {
+		t.Fatalf("expected ServerName to be set from UPSTREAM_SERVER_NAME, got %q", creds.Info().ServerName)
+	}
+}
+
+func TestSplitCSV(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a.example.com", []string{"a.example.com"}},
+		{"a.example.com,b.example.com", []string{"a.example.com", "b.example.com"}},
+		{"a.example.com, ,b.example.com,", []string{"a.example.com", " ", "b.example.com"}},
+	}
+	for _, c := range cases {
+		got := splitCSV(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitCSV(%q) = %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
+
+// testCAPEM is a self-signed certificate used only to exercise the
+// x509.NewCertPool().AppendCertsFromPEM path in upstreamCredentials; it is
+// not used to establish any real connection.
+const testCAPEM = `-----BEGIN CERTIFICATE-----
+MIIBeDCCAR+gAwIBAgIUdeSefW6xWNoFf9JhoPAMPa9/IvkwCgYIKoZIzj0EAwIw
+EjEQMA4GA1UECgwHVGVzdCBDQTAeFw0yNjA3MjcxOTQ1MzVaFw0zNjA3MjQxOTQ1
+MzVaMBIxEDAOBgNVBAoMB1Rlc3QgQ0EwWTATBgcqhkjOPQIBBggqhkjOPQMBBwNC
+AAQlWQCWlyuH8rjRgag7UCr4c9VxsqBxImIhwkaiYhVlaAahiZgM0lndX9uGT7LX
+piRz9VAGKT8X+Lkk0I1olU4zo1MwUTAdBgNVHQ4EFgQUM15w8j1xxfjBByEdOY0D
+SCw3u8swHwYDVR0jBBgwFoAUM15w8j1xxfjBByEdOY0DSCw3u8swDwYDVR0TAQH/
+BAUwAwEB/zAKBggqhkjOPQQDAgNHADBEAiB6Hk0XHh2iJKSt3R+8ZE0SWmYsy/j4
+ix1cg+OJFLUTUAIgHhyAllSDUJBOdrtm5vv4ivM1L+juHoV6b969v+dfl+0=
+-----END CERTIFICATE-----`